@@ -5,18 +5,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/instancemgmt"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/resource/httpadapter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/jkroepke/grafana-provisioner-reloader/pkg/plugin/metrics"
+	"github.com/jkroepke/grafana-provisioner-reloader/pkg/plugin/observer"
+	"github.com/jkroepke/grafana-provisioner-reloader/pkg/plugin/transport"
 )
 
+// healthFailureThreshold is the rolling reload failure rate, across any
+// single target, at or above which CheckHealth reports an error even though the
+// watcher goroutines are still running.
+const healthFailureThreshold = 0.5
+
+// defaultShutdownTimeout bounds how long Dispose waits for in-flight reload
+// requests to finish before giving up.
+const defaultShutdownTimeout = 5 * time.Second
+
 // Make sure App implements required interfaces. This is important to do
 // since otherwise we will only get a not implemented error response from plugin in
 // runtime. Plugin should not implement all these interfaces - only those which are
@@ -31,23 +48,58 @@ var (
 type App struct {
 	backend.CallResourceHandler
 
-	httpClient     *http.Client
-	disposeCh      chan struct{}
-	logger         log.Logger
-	healthStatus   backend.HealthStatus
-	healthStatusMu sync.RWMutex
-	saToken        string
-	grafanaURL     string
+	httpClient      *http.Client
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+	shutdownTimeout time.Duration
+	restarts        atomic.Int64
+	logger          log.Logger
+	saToken         string
+	grafanaURL      string
+	observers       []*observer.Observer
+	registry        *prometheus.Registry
+	metrics         *metrics.Metrics
 }
 
-var healthStatusMessage = map[backend.HealthStatus]string{
-	backend.HealthStatusOk:    "ok",
-	backend.HealthStatusError: "error",
+// TargetConfig describes a single reloadable Grafana provisioning subsystem:
+// which kind of provisioning API to call and which paths to watch for it.
+// Include/Ignore are glob patterns (e.g. "*.yaml", "**/*.json"). Include is
+// matched against a changed file's base name; Ignore is matched against
+// every component of a path, so it also excludes whole directories from
+// being watched. Ignore defaults to observer.DefaultIgnore when unset.
+type TargetConfig struct {
+	Name     string        `json:"name"`
+	Kind     observer.Kind `json:"kind"`
+	Paths    []string      `json:"paths"`
+	Include  []string      `json:"include"`
+	Ignore   []string      `json:"ignore"`
+	Debounce string        `json:"debounce"`
 }
 
 type Config struct {
-	FSWatcher  []string `json:"fsWatcher"`
-	GrafanaURL string   `json:"grafanaURL"`
+	Targets         []TargetConfig `json:"targets"`
+	GrafanaURL      string         `json:"grafanaURL"`
+	ShutdownTimeout string         `json:"shutdownTimeout"`
+	Auth            AuthConfig     `json:"auth"`
+}
+
+// AuthConfig selects how the plugin authenticates its reload requests
+// against Grafana. Type defaults to "bearer", the static service account
+// token the SDK already provides via PluginAppClientSecret. "fileToken"
+// re-reads a token from TokenPath on every request, for deployments that
+// mount a rotating Kubernetes projected token instead. "basic" authenticates
+// with BasicAuthUser and a "basicAuthPassword" secure JSON field, for
+// Grafana instances still using admin credentials. "mtls" authenticates
+// with the client certificate/key at ClientCertPath/ClientKeyPath.
+type AuthConfig struct {
+	Type string `json:"type"`
+
+	TokenPath string `json:"tokenPath"`
+
+	BasicAuthUser string `json:"basicAuthUser"`
+
+	ClientCertPath string `json:"clientCertPath"`
+	ClientKeyPath  string `json:"clientKeyPath"`
 }
 
 // NewApp creates a new example *App instance.
@@ -57,6 +109,9 @@ func NewApp(ctx context.Context, settings backend.AppInstanceSettings) (instance
 		err error
 	)
 
+	app.registry = prometheus.NewRegistry()
+	app.metrics = metrics.New(app.registry)
+
 	// Use a httpadapter (provided by the SDK) for resource calls. This allows us
 	// to use a *http.ServeMux for resource calls, so we can map multiple routes
 	// to CallResource without having to implement extra logic.
@@ -65,7 +120,6 @@ func NewApp(ctx context.Context, settings backend.AppInstanceSettings) (instance
 	app.CallResourceHandler = httpadapter.New(mux)
 
 	app.logger = log.DefaultLogger.FromContext(ctx)
-	app.disposeCh = make(chan struct{})
 
 	cfg := backend.GrafanaConfigFromContext(ctx)
 
@@ -95,65 +149,223 @@ func NewApp(ctx context.Context, settings backend.AppInstanceSettings) (instance
 		return nil, fmt.Errorf("http client options: %w", err)
 	}
 
+	if config.Auth.Type == "mtls" {
+		if err := applyMTLSOptions(&opts, config.Auth); err != nil {
+			app.logger.Error("failed to configure mtls auth", "error", err)
+
+			return nil, fmt.Errorf("failed to configure mtls auth: %w", err)
+		}
+	}
+
 	app.httpClient, err = httpclient.New(opts)
 	if err != nil {
 		return nil, fmt.Errorf("httpclient new: %w", err)
 	}
 
+	authTransport, err := app.buildAuthTransport(settings, config.Auth, app.httpClient.Transport)
+	if err != nil {
+		app.logger.Error("failed to build auth transport", "type", config.Auth.Type, "error", err)
+
+		return nil, fmt.Errorf("failed to build auth transport: %w", err)
+	}
+
+	app.httpClient.Transport = otelhttp.NewTransport(authTransport)
+
 	app.grafanaURL = "http://localhost:3000"
 
-	if config.GrafanaURL == "" {
+	if config.GrafanaURL != "" {
 		app.grafanaURL = strings.TrimSuffix(config.GrafanaURL, "/")
 	}
 
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		app.logger.Error("failed to create watcher", "error", err)
+	app.shutdownTimeout = defaultShutdownTimeout
+
+	if config.ShutdownTimeout != "" {
+		app.shutdownTimeout, err = time.ParseDuration(config.ShutdownTimeout)
+		if err != nil {
+			app.logger.Error("failed to parse shutdownTimeout", "shutdownTimeout", config.ShutdownTimeout, "error", err)
 
-		return nil, fmt.Errorf("failed to create watcher: %w", err)
+			return nil, fmt.Errorf("failed to parse shutdownTimeout: %w", err)
+		}
 	}
 
-	for _, path := range config.FSWatcher {
-		if err := watcher.Add(path); err != nil {
-			app.logger.Error("failed to add path to watcher", "path", path, "error", err)
+	for _, target := range config.Targets {
+		var debounce time.Duration
+
+		if target.Debounce != "" {
+			debounce, err = time.ParseDuration(target.Debounce)
+			if err != nil {
+				app.logger.Error("failed to parse debounce", "target", target.Name, "debounce", target.Debounce, "error", err)
+
+				return nil, fmt.Errorf("failed to parse debounce for target %q: %w", target.Name, err)
+			}
+		}
+
+		watch := observer.Watch{
+			Paths:   target.Paths,
+			Include: target.Include,
+			Ignore:  target.Ignore,
+		}
+
+		obs, err := observer.New(app.logger, app.httpClient, app.metrics, target.Name, target.Kind, app.grafanaURL, watch, debounce, app.shutdownTimeout)
+		if err != nil {
+			app.logger.Error("failed to create observer", "target", target.Name, "kind", target.Kind, "error", err)
 
-			return nil, fmt.Errorf("failed to add path to watcher: %w", err)
+			return nil, fmt.Errorf("failed to create observer for target %q: %w", target.Name, err)
 		}
+
+		app.observers = append(app.observers, obs)
 	}
 
-	go app.run(watcher)
+	runCtx, cancel := context.WithCancel(context.Background())
+	app.cancel = cancel
+
+	app.run(runCtx)
 
 	return &app, nil
 }
 
+// run starts a supervised goroutine per configured observer. Each goroutine
+// runs until ctx is cancelled, recovering from panics and restarting with
+// backoff if the observer's Run exits unexpectedly.
+func (a *App) run(ctx context.Context) {
+	for _, obs := range a.observers {
+		a.wg.Add(1)
+
+		go func(obs *observer.Observer) {
+			defer a.wg.Done()
+
+			supervise(ctx, a.logger, &a.restarts, obs.Run, obs.Reset)
+		}(obs)
+	}
+}
+
 // Dispose here tells plugin SDK that plugin wants to clean up resources when a new instance
 // created.
 func (a *App) Dispose() {
-	if _, ok := <-a.disposeCh; !ok {
-		// The dispose channel is already closed, so the goroutine has stopped.
-		return
-	}
+	a.cancel()
 
-	// Signal the running goroutine to stop.
-	a.disposeCh <- struct{}{}
+	done := make(chan struct{})
+
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
 
-	// Wait for the goroutine to stop.
 	select {
-	case <-a.disposeCh:
-		// The goroutine has stopped.
-	case <-time.After(5 * time.Second):
-		// The goroutine has not stopped after 5 seconds. Log an error.
-		a.logger.Error("failed to stop the plugin")
+	case <-done:
+		// All watcher goroutines have stopped, and any reload request they
+		// had in flight either finished or hit its own shutdownTimeout (see
+		// Observer.doRequest).
+	case <-time.After(a.shutdownTimeout):
+		a.logger.Error("timed out waiting for reload goroutines to stop", "timeout", a.shutdownTimeout)
 	}
 }
 
+// registerRoutes wires the plugin's resource routes onto mux.
+func (a *App) registerRoutes(mux *http.ServeMux) {
+	mux.Handle("/metrics", promhttp.HandlerFor(a.registry, promhttp.HandlerOpts{}))
+}
+
 // CheckHealth handles health checks sent from Grafana to the plugin.
 func (a *App) CheckHealth(_ context.Context, _ *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
-	a.healthStatusMu.RLock()
-	defer a.healthStatusMu.RUnlock()
+	restarts := a.restarts.Load()
+
+	for _, obs := range a.observers {
+		if open, consecutive := obs.CircuitOpen(); open {
+			return &backend.CheckHealthResult{
+				Status:  backend.HealthStatusError,
+				Message: fmt.Sprintf("circuit breaker open after %d consecutive reload failures (restarts: %d)", consecutive, restarts),
+			}, nil
+		}
+	}
+
+	if rate := a.maxFailureRate(); rate >= healthFailureThreshold {
+		return &backend.CheckHealthResult{
+			Status:  backend.HealthStatusError,
+			Message: fmt.Sprintf("reload failure rate is %.0f%% (restarts: %d)", rate*100, restarts),
+		}, nil
+	}
 
 	return &backend.CheckHealthResult{
-		Status:  a.healthStatus,
-		Message: healthStatusMessage[a.healthStatus],
+		Status:  backend.HealthStatusOk,
+		Message: fmt.Sprintf("ok (restarts: %d)", restarts),
 	}, nil
 }
+
+// buildAuthTransport wraps base with the http.RoundTripper selected by
+// cfg.Type, defaulting to a static bearer token built from the plugin's
+// service account secret. "mtls" is handled before base is even built (see
+// applyMTLSOptions in NewApp), since the client certificate has to be wired
+// into the transport's TLS config, not layered on top of it as a header; by
+// the time base reaches here, it already authenticates and just passes
+// through unchanged.
+func (a *App) buildAuthTransport(settings backend.AppInstanceSettings, cfg AuthConfig, base http.RoundTripper) (http.RoundTripper, error) {
+	switch cfg.Type {
+	case "", "bearer":
+		return transport.NewBearerTokenTransport(a.saToken, base), nil
+	case "fileToken":
+		if cfg.TokenPath == "" {
+			return nil, fmt.Errorf("auth.tokenPath is required for auth type %q", cfg.Type)
+		}
+
+		return transport.NewFileTokenTransport(cfg.TokenPath, base), nil
+	case "basic":
+		if cfg.BasicAuthUser == "" {
+			return nil, fmt.Errorf("auth.basicAuthUser is required for auth type %q", cfg.Type)
+		}
+
+		password := settings.DecryptedSecureJSONData["basicAuthPassword"]
+
+		return transport.NewBasicAuthTransport(cfg.BasicAuthUser, password, base), nil
+	case "mtls":
+		return base, nil
+	default:
+		return nil, fmt.Errorf("unknown auth type %q", cfg.Type)
+	}
+}
+
+// applyMTLSOptions loads the client certificate/key configured for "mtls"
+// auth and adds them to opts.TLS, so httpclient.New builds the mTLS
+// handshake into the transport it constructs. Earlier code tried to bolt
+// this onto the already-built http.Client.Transport by type-asserting it to
+// *http.Transport, but httpclient.New wraps its transport in middleware
+// (proxy, timeouts, default middlewares), so that assertion always failed
+// and silently replaced the SDK-configured client with a bare one.
+func applyMTLSOptions(opts *httpclient.Options, cfg AuthConfig) error {
+	if cfg.ClientCertPath == "" || cfg.ClientKeyPath == "" {
+		return fmt.Errorf("auth.clientCertPath and auth.clientKeyPath are required for auth type %q", cfg.Type)
+	}
+
+	cert, err := os.ReadFile(cfg.ClientCertPath)
+	if err != nil {
+		return fmt.Errorf("failed to read client certificate %q: %w", cfg.ClientCertPath, err)
+	}
+
+	key, err := os.ReadFile(cfg.ClientKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read client key %q: %w", cfg.ClientKeyPath, err)
+	}
+
+	if opts.TLS == nil {
+		opts.TLS = &httpclient.TLSOptions{}
+	}
+
+	opts.TLS.ClientCertificate = string(cert)
+	opts.TLS.ClientKey = string(key)
+
+	return nil
+}
+
+// maxFailureRate returns the highest rolling reload failure rate across all
+// configured targets.
+func (a *App) maxFailureRate() float64 {
+	var max float64
+
+	for _, obs := range a.observers {
+		if rate := obs.FailureRate(); rate > max {
+			max = rate
+		}
+	}
+
+	return max
+}
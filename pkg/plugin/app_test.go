@@ -0,0 +1,274 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/httpclient"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+
+	"github.com/jkroepke/grafana-provisioner-reloader/pkg/plugin/observer"
+	"github.com/jkroepke/grafana-provisioner-reloader/pkg/plugin/transport"
+)
+
+func TestCheckHealthReportsErrorAboveFailureThreshold(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	watch := observer.Watch{Paths: []string{dir}, Include: []string{"*.yaml"}}
+
+	obs, err := observer.New(log.NewNullLogger(), srv.Client(), nil, "target", observer.KindDashboards, srv.URL, watch, 10*time.Millisecond, time.Second)
+	if err != nil {
+		t.Fatalf("observer.New: %v", err)
+	}
+
+	a := &App{logger: log.NewNullLogger(), observers: []*observer.Observer{obs}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go obs.Run(ctx)
+
+	path := filepath.Join(dir, "dashboard.yaml")
+	if err := os.WriteFile(path, []byte("a: 1"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	deadline := time.Now().Add(15 * time.Second)
+
+	for a.maxFailureRate() < healthFailureThreshold {
+		if time.Now().After(deadline) {
+			t.Fatalf("failure rate never crossed %v, got %v", healthFailureThreshold, a.maxFailureRate())
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	result, err := a.CheckHealth(ctx, &backend.CheckHealthRequest{})
+	if err != nil {
+		t.Fatalf("CheckHealth: %v", err)
+	}
+
+	if result.Status != backend.HealthStatusError {
+		t.Errorf("Status = %v, want %v", result.Status, backend.HealthStatusError)
+	}
+}
+
+func TestCheckHealthOkWithNoObservers(t *testing.T) {
+	a := &App{logger: log.NewNullLogger()}
+
+	result, err := a.CheckHealth(context.Background(), &backend.CheckHealthRequest{})
+	if err != nil {
+		t.Fatalf("CheckHealth: %v", err)
+	}
+
+	if result.Status != backend.HealthStatusOk {
+		t.Errorf("Status = %v, want %v", result.Status, backend.HealthStatusOk)
+	}
+}
+
+func TestBuildAuthTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     AuthConfig
+		secure  map[string]string
+		want    any
+		wantErr bool
+	}{
+		{
+			name: "default is bearer",
+			cfg:  AuthConfig{},
+			want: &transport.TokenTransport{},
+		},
+		{
+			name: "explicit bearer",
+			cfg:  AuthConfig{Type: "bearer"},
+			want: &transport.TokenTransport{},
+		},
+		{
+			name: "fileToken",
+			cfg:  AuthConfig{Type: "fileToken", TokenPath: "/var/run/secrets/token"},
+			want: &transport.FileTokenTransport{},
+		},
+		{
+			name:    "fileToken missing tokenPath",
+			cfg:     AuthConfig{Type: "fileToken"},
+			wantErr: true,
+		},
+		{
+			name:   "basic",
+			cfg:    AuthConfig{Type: "basic", BasicAuthUser: "admin"},
+			secure: map[string]string{"basicAuthPassword": "hunter2"},
+			want:   &transport.BasicAuthTransport{},
+		},
+		{
+			name:    "basic missing basicAuthUser",
+			cfg:     AuthConfig{Type: "basic"},
+			wantErr: true,
+		},
+		{
+			name: "mtls passes base through unchanged",
+			cfg:  AuthConfig{Type: "mtls"},
+			want: http.DefaultTransport,
+		},
+		{
+			name:    "unknown type",
+			cfg:     AuthConfig{Type: "oidc"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &App{saToken: "sa-token"}
+			settings := backend.AppInstanceSettings{DecryptedSecureJSONData: tt.secure}
+
+			got, err := a.buildAuthTransport(settings, tt.cfg, http.DefaultTransport)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("buildAuthTransport(%+v): expected error, got nil", tt.cfg)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("buildAuthTransport(%+v): %v", tt.cfg, err)
+			}
+
+			switch tt.want.(type) {
+			case *transport.TokenTransport:
+				if _, ok := got.(*transport.TokenTransport); !ok {
+					t.Errorf("got %T, want *transport.TokenTransport", got)
+				}
+			case *transport.FileTokenTransport:
+				if _, ok := got.(*transport.FileTokenTransport); !ok {
+					t.Errorf("got %T, want *transport.FileTokenTransport", got)
+				}
+			case *transport.BasicAuthTransport:
+				if _, ok := got.(*transport.BasicAuthTransport); !ok {
+					t.Errorf("got %T, want *transport.BasicAuthTransport", got)
+				}
+			default:
+				if got != tt.want {
+					t.Errorf("got %v, want %v (mtls should pass base through unchanged)", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// generateSelfSignedCertKeyPair writes a throwaway self-signed ECDSA
+// certificate and key pair to files under t.TempDir() and returns their
+// paths, for exercising applyMTLSOptions against real PEM input.
+func generateSelfSignedCertKeyPair(t *testing.T) (certPath, keyPath string) {
+	t.Helper()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-client"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %v", err)
+	}
+
+	dir := t.TempDir()
+	certPath = filepath.Join(dir, "client.crt")
+	keyPath = filepath.Join(dir, "client.key")
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	return certPath, keyPath
+}
+
+func TestApplyMTLSOptions(t *testing.T) {
+	certPath, keyPath := generateSelfSignedCertKeyPair(t)
+
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatalf("read cert: %v", err)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatalf("read key: %v", err)
+	}
+
+	var opts httpclient.Options
+
+	cfg := AuthConfig{Type: "mtls", ClientCertPath: certPath, ClientKeyPath: keyPath}
+
+	if err := applyMTLSOptions(&opts, cfg); err != nil {
+		t.Fatalf("applyMTLSOptions: %v", err)
+	}
+
+	if opts.TLS == nil {
+		t.Fatal("opts.TLS is nil, want it populated")
+	}
+
+	if opts.TLS.ClientCertificate != string(certPEM) {
+		t.Errorf("ClientCertificate = %q, want %q", opts.TLS.ClientCertificate, string(certPEM))
+	}
+
+	if opts.TLS.ClientKey != string(keyPEM) {
+		t.Errorf("ClientKey = %q, want %q", opts.TLS.ClientKey, string(keyPEM))
+	}
+}
+
+func TestApplyMTLSOptionsMissingPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  AuthConfig
+	}{
+		{name: "missing both", cfg: AuthConfig{Type: "mtls"}},
+		{name: "missing key", cfg: AuthConfig{Type: "mtls", ClientCertPath: "/tmp/cert.pem"}},
+		{name: "missing cert", cfg: AuthConfig{Type: "mtls", ClientKeyPath: "/tmp/key.pem"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts httpclient.Options
+
+			if err := applyMTLSOptions(&opts, tt.cfg); err == nil {
+				t.Errorf("applyMTLSOptions(%+v): expected error, got nil", tt.cfg)
+			}
+		})
+	}
+}
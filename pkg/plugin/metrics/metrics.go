@@ -0,0 +1,46 @@
+// Package metrics defines the Prometheus collectors exposed by the plugin
+// on its /metrics resource route.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics groups the collectors tracking reload activity across all
+// configured targets.
+type Metrics struct {
+	ReloadTriggered *prometheus.CounterVec
+	ReloadSuccess   *prometheus.CounterVec
+	ReloadFailure   *prometheus.CounterVec
+	ReloadDuration  *prometheus.HistogramVec
+	WatchedFiles    *prometheus.GaugeVec
+}
+
+// New creates the plugin's metrics and registers them against reg.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		ReloadTriggered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "reload_triggered_total",
+			Help: "Number of reload requests triggered by a file change, per target.",
+		}, []string{"target"}),
+		ReloadSuccess: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "reload_success_total",
+			Help: "Number of reload requests that completed successfully, per target.",
+		}, []string{"target"}),
+		ReloadFailure: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "reload_failure_total",
+			Help: "Number of reload requests that failed, per target and response status.",
+		}, []string{"target", "status"}),
+		ReloadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "reload_duration_seconds",
+			Help:    "Duration of reload requests, per target.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"target"}),
+		WatchedFiles: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "watched_files",
+			Help: "Number of files and directories currently watched, per target.",
+		}, []string{"target"}),
+	}
+
+	reg.MustRegister(m.ReloadTriggered, m.ReloadSuccess, m.ReloadFailure, m.ReloadDuration, m.WatchedFiles)
+
+	return m
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewRegistersWithoutPanicking(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	m := New(reg)
+
+	m.ReloadTriggered.WithLabelValues("target").Inc()
+	m.ReloadSuccess.WithLabelValues("target").Inc()
+	m.ReloadFailure.WithLabelValues("target", "500").Inc()
+	m.ReloadDuration.WithLabelValues("target").Observe(1.5)
+	m.WatchedFiles.WithLabelValues("target").Set(3)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	if len(families) != 5 {
+		t.Errorf("got %d registered metric families, want 5", len(families))
+	}
+}
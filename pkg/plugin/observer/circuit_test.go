@@ -0,0 +1,58 @@
+package observer
+
+import "testing"
+
+func TestRecordOutcomeOpensCircuitBreaker(t *testing.T) {
+	o := newTestObserver(t, Watch{})
+
+	if open, _ := o.CircuitOpen(); open {
+		t.Fatalf("breaker should start closed")
+	}
+
+	for i := 0; i < circuitBreakerThreshold-1; i++ {
+		o.recordOutcome(false)
+	}
+
+	if open, _ := o.CircuitOpen(); open {
+		t.Errorf("breaker should stay closed before reaching the threshold")
+	}
+
+	o.recordOutcome(false)
+
+	open, consecutive := o.CircuitOpen()
+	if !open {
+		t.Errorf("breaker should open after %d consecutive failures", circuitBreakerThreshold)
+	}
+
+	if consecutive != circuitBreakerThreshold {
+		t.Errorf("consecutive failures = %d, want %d", consecutive, circuitBreakerThreshold)
+	}
+
+	o.recordOutcome(true)
+
+	if open, _ := o.CircuitOpen(); open {
+		t.Errorf("breaker should close again after a success")
+	}
+}
+
+func TestFailureRateTracksRecentOutcomes(t *testing.T) {
+	o := newTestObserver(t, Watch{})
+
+	if rate := o.FailureRate(); rate != 0 {
+		t.Fatalf("initial failure rate = %v, want 0", rate)
+	}
+
+	o.recordOutcome(false)
+
+	if rate := o.FailureRate(); rate <= 0 {
+		t.Errorf("failure rate should rise after a failure, got %v", rate)
+	}
+
+	for i := 0; i < 50; i++ {
+		o.recordOutcome(true)
+	}
+
+	if rate := o.FailureRate(); rate >= 0.01 {
+		t.Errorf("failure rate should decay back toward 0 after repeated successes, got %v", rate)
+	}
+}
@@ -2,59 +2,282 @@ package observer
 
 import (
 	"context"
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/fsnotify/fsnotify"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jkroepke/grafana-provisioner-reloader/pkg/plugin/metrics"
+)
+
+var tracer = otel.Tracer("github.com/jkroepke/grafana-provisioner-reloader/pkg/plugin/observer")
+
+// Kind identifies a Grafana provisioning subsystem that can be reloaded
+// through the admin provisioning API.
+type Kind string
+
+const (
+	KindDashboards    Kind = "dashboards"
+	KindDatasources   Kind = "datasources"
+	KindPlugins       Kind = "plugins"
+	KindNotifications Kind = "notifications"
+	KindAlerting      Kind = "alerting"
+	KindAccessControl Kind = "accesscontrol"
 )
 
+// DefaultDebounce is used when a target does not configure its own debounce window.
+const DefaultDebounce = 5 * time.Second
+
+// maxFingerprintSize bounds how large a file we will hash on every write event.
+// Larger files fall back to a mtime+size fingerprint instead.
+const maxFingerprintSize = 10 * 1024 * 1024 // 10MiB
+
+// reloadPaths maps a target Kind to the path segment used by Grafana's
+// POST /api/admin/provisioning/{kind}/reload endpoints.
+var reloadPaths = map[Kind]string{
+	KindDashboards:    "dashboards",
+	KindDatasources:   "datasources",
+	KindPlugins:       "plugins",
+	KindNotifications: "notifications",
+	KindAlerting:      "alerting",
+	KindAccessControl: "access-control",
+}
+
 type Observer struct {
-	endpoint string
+	name            string
+	kind            Kind
+	watch           Watch
+	endpoint        string
+	debounce        time.Duration
+	shutdownTimeout time.Duration
 
 	logger     log.Logger
 	httpClient *http.Client
+	metrics    *metrics.Metrics
 
 	watcher *fsnotify.Watcher
 
-	reloadCh chan struct{}
-	errCh    chan error
+	reloadCh    chan struct{}
+	errCh       chan error
+	lastChanged atomic.Value // string
+
+	fingerprintsMu sync.Mutex
+	fingerprints   map[string]string
+
+	stateMu             sync.Mutex
+	failureRate         float64
+	consecutiveFailures int
+	breakerOpenedAt     time.Time
 }
 
-func New(logger log.Logger, httpClient *http.Client, name, endpoint string, paths []string) (*Observer, error) {
-	watcher, err := fsnotify.NewWatcher()
+// failureRateDecay controls how quickly FailureRate forgets old outcomes;
+// it is an exponentially-weighted moving average over reload attempts.
+const failureRateDecay = 0.2
+
+// circuitBreakerThreshold is the number of consecutive reload failures after
+// which the observer stops sending requests for circuitBreakerCooldown.
+const circuitBreakerThreshold = 5
+
+// circuitBreakerCooldown is how long the circuit breaker stays open before a
+// single probe attempt is let through to check whether Grafana has recovered.
+const circuitBreakerCooldown = 60 * time.Second
+
+// reloadBackOff builds the exponential backoff policy used to retry a failed
+// reload request, bound to ctx so retries stop once the observer shuts down.
+func reloadBackOff(ctx context.Context) backoff.BackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	b.Multiplier = 2
+	b.MaxInterval = 60 * time.Second
+	b.MaxElapsedTime = 10 * time.Minute
+
+	return backoff.WithContext(b, ctx)
+}
+
+// New creates an Observer that watches watch for changes and, on change,
+// reloads the Grafana provisioning subsystem identified by kind. A zero
+// debounce falls back to DefaultDebounce. m may be nil, in which case no
+// metrics are recorded. shutdownTimeout bounds how long an in-flight reload
+// request is allowed to run past the watch loop being cancelled (see
+// doRequest).
+func New(logger log.Logger, httpClient *http.Client, m *metrics.Metrics, name string, kind Kind, grafanaURL string, watch Watch, debounce, shutdownTimeout time.Duration) (*Observer, error) {
+	reloadPath, ok := reloadPaths[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown target kind %q", kind)
+	}
+
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+
+	if watch.Ignore == nil {
+		watch.Ignore = DefaultIgnore
+	}
+
+	l := logger.With("observer", name, "kind", kind)
+
+	watcher, err := newWatcher(l, watch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create watcher: %w", err)
+		return nil, err
 	}
 
-	for _, path := range paths {
-		if err = watcher.Add(path); err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				logger.Warn("failed to add path to watcher", "path", path, "err", err)
-				continue
-			}
+	endpoint := strings.TrimSuffix(grafanaURL, "/") + "/api/admin/provisioning/" + reloadPath + "/reload"
 
-			return nil, fmt.Errorf("failed to add path %q to watcher: %w", path, err)
-		}
+	if m != nil {
+		m.WatchedFiles.WithLabelValues(name).Set(float64(len(watcher.WatchList())))
 	}
 
 	return &Observer{
-		logger:     logger.With("observer", name),
-		httpClient: httpClient,
-		endpoint:   endpoint,
-		watcher:    watcher,
-		reloadCh:   make(chan struct{}, 50),
+		name:            name,
+		kind:            kind,
+		watch:           watch,
+		logger:          l,
+		httpClient:      httpClient,
+		metrics:         m,
+		endpoint:        endpoint,
+		debounce:        debounce,
+		shutdownTimeout: shutdownTimeout,
+		watcher:         watcher,
+		reloadCh:        make(chan struct{}, 50),
+		fingerprints:    make(map[string]string),
 	}, nil
 }
 
+// Reset rebuilds the observer's fsnotify watcher and reload queue so Run can
+// be safely retried after an unexpected exit, e.g. a recovered panic. The
+// previous watcher is closed first: Run only closes it on a clean ctx.Done()
+// exit, so a panic leaves it behind, and restarting without closing it would
+// leak its inotify watches on every restart.
+func (o *Observer) Reset() error {
+	if err := o.watcher.Close(); err != nil {
+		o.logger.Error("failed to close watcher before reset", "error", err)
+	}
+
+	watcher, err := newWatcher(o.logger, o.watch)
+	if err != nil {
+		return err
+	}
+
+	o.watcher = watcher
+	o.reloadCh = make(chan struct{}, 50)
+
+	if o.metrics != nil {
+		o.metrics.WatchedFiles.WithLabelValues(o.name).Set(float64(len(watcher.WatchList())))
+	}
+
+	return nil
+}
+
+// FailureRate returns the observer's rolling reload failure rate, from 0
+// (every recent reload succeeded) to 1 (every recent reload failed).
+func (o *Observer) FailureRate() float64 {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+
+	return o.failureRate
+}
+
+// CircuitOpen reports whether the circuit breaker is currently open, along
+// with the number of consecutive failures that opened it.
+func (o *Observer) CircuitOpen() (bool, int) {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+
+	open := !o.breakerOpenedAt.IsZero() && time.Since(o.breakerOpenedAt) < circuitBreakerCooldown
+
+	return open, o.consecutiveFailures
+}
+
+// canAttempt reports whether a reload attempt is currently allowed through
+// the circuit breaker. Once the cooldown has elapsed, a single probe attempt
+// is let through to check whether Grafana has recovered.
+func (o *Observer) canAttempt() bool {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+
+	return o.breakerOpenedAt.IsZero() || time.Since(o.breakerOpenedAt) >= circuitBreakerCooldown
+}
+
+func (o *Observer) recordOutcome(success bool) {
+	o.stateMu.Lock()
+	defer o.stateMu.Unlock()
+
+	outcome := 0.0
+
+	if success {
+		o.consecutiveFailures = 0
+		o.breakerOpenedAt = time.Time{}
+	} else {
+		outcome = 1.0
+		o.consecutiveFailures++
+
+		if o.consecutiveFailures >= circuitBreakerThreshold {
+			o.breakerOpenedAt = time.Now()
+		}
+	}
+
+	o.failureRate = o.failureRate*(1-failureRateDecay) + outcome*failureRateDecay
+}
+
 func (o *Observer) Run(ctx context.Context) {
 	o.logger.Debug("watching files", "files", o.watcher.WatchList())
 
-	go o.reload(ctx)
+	// runCtx and reloadCh are captured for this call of Run only, and the
+	// reload goroutine below is started with both by value. This ties that
+	// goroutine's lifetime to this generation: if supervise restarts Run
+	// after a panic, runCtx is cancelled on the way out (deferred below),
+	// so the old reload goroutine exits instead of leaking and racing the
+	// next generation's reload goroutine over whatever channel Reset()
+	// swaps into o.reloadCh.
+	runCtx, cancel := context.WithCancel(ctx)
+
+	reloadCh := o.reloadCh
+
+	var reloadWG sync.WaitGroup
+
+	reloadWG.Add(1)
+
+	go func() {
+		defer reloadWG.Done()
+
+		o.reload(runCtx, reloadCh)
+	}()
+
+	// cancel runCtx before joining reloadWG, on every exit path: reload()
+	// only returns once it observes runCtx.Done(), so waiting without
+	// cancelling first would deadlock on any exit that isn't already driven
+	// by ctx cancellation (e.g. the watcher's Events/Errors channel closing
+	// unexpectedly). This is what makes a.wg.Wait() in App.Dispose actually
+	// block until an in-flight reload HTTP call finishes, instead of
+	// returning the instant the watcher is closed.
+	defer func() {
+		cancel()
+		reloadWG.Wait()
+	}()
+
+	var debounceTimer *time.Timer
+
+	defer func() {
+		if debounceTimer != nil {
+			debounceTimer.Stop()
+		}
+	}()
 
 	for {
 		select {
@@ -63,20 +286,32 @@ func (o *Observer) Run(ctx context.Context) {
 				o.logger.Error("failed to close watcher", "error", err)
 			}
 
-			close(o.reloadCh)
-
+			// reload() also selects on ctx.Done(), so it exits on its own;
+			// reloadCh is intentionally left open rather than closed here,
+			// since a debounce timer can still be in flight (see
+			// enqueueReload) and closing would race its send.
 			return
 		case event, ok := <-o.watcher.Events:
 			if !ok {
 				return
 			}
 
-			if !event.Has(fsnotify.Write) {
+			if event.Has(fsnotify.Create) {
+				o.watchIfDir(event.Name)
+			}
+
+			if !o.isRelevant(event) {
 				continue
 			}
 
-			o.logger.Debug("config file changed", "file", event.Name)
-			o.reloadCh <- struct{}{}
+			o.logger.Debug("config file changed", "file", event.Name, "op", event.Op.String())
+			o.lastChanged.Store(event.Name)
+
+			if debounceTimer == nil {
+				debounceTimer = time.AfterFunc(o.debounce, func() { enqueueReload(runCtx, reloadCh) })
+			} else {
+				debounceTimer.Reset(o.debounce)
+			}
 		case err, ok := <-o.watcher.Errors:
 			if !ok {
 				return
@@ -87,43 +322,276 @@ func (o *Observer) Run(ctx context.Context) {
 	}
 }
 
-func (o *Observer) reload(ctx context.Context) {
-	for {
-		time.Sleep(30 * time.Second)
+// enqueueReload is the debounce timer's callback. It runs in its own
+// goroutine well after the event that armed the timer, so ctx may already be
+// done by the time it fires (e.g. the plugin was disposed mid-debounce, or
+// Run was restarted by supervise). Selecting on ctx.Done() alongside the
+// send keeps a late-firing timer from blocking forever once nothing is left
+// draining ch.
+func enqueueReload(ctx context.Context, ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	case <-ctx.Done():
+	}
+}
+
+// watchIfDir adds path, and every non-ignored subdirectory under it, to the
+// watcher if it turned out to be a directory. This lets newly-created
+// subfolders (e.g. a team adding its own dashboards/ subdirectory) get
+// watched without restarting the plugin.
+func (o *Observer) watchIfDir(path string) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return
+	}
+
+	// addRecursive only ignore-checks path's descendants, not path itself
+	// (it treats its root argument as already vetted by the caller, since
+	// newWatcher's initial walk starts from configured roots that aren't
+	// meant to be ignored). path here is a directory discovered at runtime
+	// via a Create event, not a configured root, so it needs that same
+	// check applied before handing it to addRecursive.
+	if isIgnored(path, o.watch.Ignore) {
+		return
+	}
+
+	if err := addRecursive(o.watcher, o.logger, path, o.watch.Ignore); err != nil {
+		o.logger.Error("failed to watch new directory", "path", path, "error", err)
+
+		return
+	}
+
+	if o.metrics != nil {
+		o.metrics.WatchedFiles.WithLabelValues(o.name).Set(float64(len(o.watcher.WatchList())))
+	}
+}
+
+// isRelevant reports whether event should (re)start the debounce window.
+// Write events are dropped by the include/ignore filter, then further
+// suppressed unless the file's content actually changed, so editor save
+// patterns that rewrite a file with identical contents don't trigger a
+// reload. Create/Rename/Remove always count without going through the
+// include filter: the event that signals a ConfigMap update lands on the
+// "..data"/"..<timestamp>" directory-metadata entry, not the tracked
+// filename itself, so requiring it to match an Include glob like "*.yaml"
+// would silently swallow the very symlink-swap this is meant to catch.
+// Ignore still applies, so VCS metadata and editor temp files are dropped.
+func (o *Observer) isRelevant(event fsnotify.Event) bool {
+	if isIgnored(event.Name, o.watch.Ignore) {
+		return false
+	}
+
+	switch {
+	case event.Has(fsnotify.Write):
+		return isIncluded(event.Name, o.watch.Include) && o.contentChanged(event.Name)
+	case event.Has(fsnotify.Create), event.Has(fsnotify.Rename), event.Has(fsnotify.Remove):
+		return true
+	default:
+		return false
+	}
+}
+
+// contentChanged fingerprints path and reports whether it differs from the
+// last-seen fingerprint for that path.
+func (o *Observer) contentChanged(path string) bool {
+	fingerprint, err := fingerprintFile(path)
+	if err != nil {
+		o.logger.Debug("failed to fingerprint file, assuming changed", "file", path, "error", err)
+
+		return true
+	}
 
+	o.fingerprintsMu.Lock()
+	defer o.fingerprintsMu.Unlock()
+
+	if o.fingerprints[path] == fingerprint {
+		return false
+	}
+
+	o.fingerprints[path] = fingerprint
+
+	return true
+}
+
+// fingerprintFile returns a sha256 digest of path's contents, or a
+// mtime+size fingerprint for files larger than maxFingerprintSize.
+func fingerprintFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	if info.Size() > maxFingerprintSize {
+		return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano()), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// reload drains ch and performs reloads until ctx is done. ch is the
+// generation-scoped channel Run started this goroutine with (see Run), not
+// o.reloadCh directly, so a restarted Run's reload goroutine never ends up
+// consuming from a channel a later Reset() swapped in.
+//
+// reload itself only runs inside the goroutine Run starts it in, which is
+// not covered by supervise's recover() (that wraps Run, not the goroutine Run
+// spawns). A panic in doReload/doRequest would otherwise take down the whole
+// plugin process, so each reload is recovered individually here instead: the
+// loop keeps draining ch and watching continues to work even if one reload
+// attempt panics.
+func (o *Observer) reload(ctx context.Context, ch chan struct{}) {
+	for {
 		select {
 		case <-ctx.Done():
 			return
-		case _, ok := <-o.reloadCh:
-			if !ok {
-				return
-			}
-
+		case <-ch:
 			// if we have more in queue, drain channel and reload only once
-			for len(o.reloadCh) > 0 {
-				<-o.reloadCh
+			for len(ch) > 0 {
+				<-ch
 			}
 
-			o.logger.Debug("reloading provisioned config")
+			o.doReloadRecovered(ctx)
+		}
+	}
+}
 
-			req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, o.endpoint, nil)
-			if err != nil {
-				o.logger.Error("failed to create request", "error", err)
+// doReloadRecovered runs doReload, recovering from and logging any panic so
+// that a single bad reload attempt can't crash the process.
+func (o *Observer) doReloadRecovered(ctx context.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			o.logger.Error("recovered from panic during reload", "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
 
-				continue
-			}
+	o.doReload(ctx)
+}
 
-			res, err := o.httpClient.Do(req)
+func (o *Observer) doReload(ctx context.Context) {
+	changedFile, _ := o.lastChanged.Load().(string)
 
-			if err != nil {
-				o.logger.Error("failed to send request", "error", err)
-			} else if err = checkResponse(res); err != nil {
-				o.logger.Error("failed to reload provisioned config", "error", err)
-			}
-		default:
-			// no reload request in queue
+	ctx, span := tracer.Start(ctx, "observer.reload", trace.WithAttributes(
+		attribute.String("target.name", o.name),
+		attribute.String("target.kind", string(o.kind)),
+		attribute.String("target.endpoint", o.endpoint),
+		attribute.String("target.changed_file", changedFile),
+	))
+	defer span.End()
+
+	if !o.canAttempt() {
+		o.logger.Warn("circuit breaker open, skipping reload")
+		span.SetStatus(codes.Error, "circuit breaker open")
+
+		if o.metrics != nil {
+			o.metrics.ReloadFailure.WithLabelValues(o.name, "circuit_open").Inc()
+		}
+
+		return
+	}
+
+	if o.metrics != nil {
+		o.metrics.ReloadTriggered.WithLabelValues(o.name).Inc()
+	}
+
+	start := time.Now()
+
+	o.logger.Debug("reloading provisioned config")
+
+	var status string
+
+	// recordOutcome runs per HTTP attempt, not once after the whole retry
+	// cycle: RetryNotify's notify callback isn't invoked for the attempt
+	// that ends the cycle, and MaxElapsedTime is 10 minutes, so recording
+	// only at the end would let "N consecutive failures" mean N ~10-minute
+	// hammering cycles before the breaker opens. Tripping it mid-cycle also
+	// lets a retry cycle abort immediately via backoff.Permanent instead of
+	// continuing to hammer Grafana until MaxElapsedTime elapses.
+	err := backoff.RetryNotify(func() error {
+		var reqErr error
+
+		status, reqErr = o.doRequest(ctx)
+		if reqErr == nil {
+			return nil
+		}
+
+		o.recordOutcome(false)
+
+		if open, consecutive := o.CircuitOpen(); open {
+			return backoff.Permanent(fmt.Errorf("circuit breaker open after %d consecutive failures: %w", consecutive, reqErr))
+		}
+
+		return reqErr
+	}, reloadBackOff(ctx), func(err error, wait time.Duration) {
+		o.logger.Warn("reload attempt failed, retrying", "error", err, "wait", wait)
+	})
+
+	duration := time.Since(start)
+	if o.metrics != nil {
+		o.metrics.ReloadDuration.WithLabelValues(o.name).Observe(duration.Seconds())
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+
+		if o.metrics != nil {
+			o.metrics.ReloadFailure.WithLabelValues(o.name, status).Inc()
 		}
+
+		o.logger.Error("failed to reload provisioned config", "error", err)
+
+		return
+	}
+
+	o.recordOutcome(true)
+	span.SetAttributes(attribute.String("http.status", status))
+
+	if o.metrics != nil {
+		o.metrics.ReloadSuccess.WithLabelValues(o.name).Inc()
+	}
+}
+
+// doRequest performs the reload HTTP call and returns a status label
+// suitable for metrics/trace attributes ("error" for transport failures,
+// otherwise the numeric HTTP status code). The request runs on a context
+// detached from ctx's cancellation (though it keeps ctx's values, e.g. the
+// trace span doReload started): ctx is cancelled the instant Dispose calls
+// App.cancel, and without detaching, that would abort an in-flight reload
+// request outright instead of letting Dispose's shutdownTimeout wait mean
+// anything. shutdownTimeout still bounds the detached request, so a reload
+// against a wedged Grafana doesn't hang forever.
+func (o *Observer) doRequest(ctx context.Context) (string, error) {
+	reqCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.shutdownTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, o.endpoint, nil)
+	if err != nil {
+		return "error", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	res, err := o.httpClient.Do(req)
+	if err != nil {
+		return "error", fmt.Errorf("failed to send request: %w", err)
 	}
+
+	status := strconv.Itoa(res.StatusCode)
+
+	if err = checkResponse(res); err != nil {
+		return status, err
+	}
+
+	return status, nil
 }
 
 func checkResponse(res *http.Response) error {
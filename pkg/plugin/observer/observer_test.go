@@ -0,0 +1,105 @@
+package observer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func newTestObserver(t *testing.T, watch Watch) *Observer {
+	t.Helper()
+
+	return &Observer{
+		watch:        watch,
+		logger:       log.NewNullLogger(),
+		fingerprints: make(map[string]string),
+	}
+}
+
+func TestFingerprintFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dashboard.yaml")
+
+	if err := os.WriteFile(path, []byte("a: 1"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	first, err := fingerprintFile(path)
+	if err != nil {
+		t.Fatalf("fingerprintFile: %v", err)
+	}
+
+	second, err := fingerprintFile(path)
+	if err != nil {
+		t.Fatalf("fingerprintFile: %v", err)
+	}
+
+	if first != second {
+		t.Errorf("fingerprint of unchanged file should be stable, got %q then %q", first, second)
+	}
+
+	if err := os.WriteFile(path, []byte("a: 2"), 0o600); err != nil {
+		t.Fatalf("rewrite file: %v", err)
+	}
+
+	changed, err := fingerprintFile(path)
+	if err != nil {
+		t.Fatalf("fingerprintFile: %v", err)
+	}
+
+	if changed == first {
+		t.Errorf("fingerprint should change when content changes")
+	}
+}
+
+func TestIsRelevant_WriteRequiresIncludeAndContentChange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dashboard.yaml")
+
+	if err := os.WriteFile(path, []byte("a: 1"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	o := newTestObserver(t, Watch{Include: []string{"*.yaml"}})
+
+	if !o.isRelevant(fsnotify.Event{Name: path, Op: fsnotify.Write}) {
+		t.Errorf("first write of an included file should be relevant")
+	}
+
+	if o.isRelevant(fsnotify.Event{Name: path, Op: fsnotify.Write}) {
+		t.Errorf("rewriting identical content should not be relevant")
+	}
+
+	excluded := filepath.Join(dir, "README.md")
+	if err := os.WriteFile(excluded, []byte("hello"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	if o.isRelevant(fsnotify.Event{Name: excluded, Op: fsnotify.Write}) {
+		t.Errorf("write to a non-included file should not be relevant")
+	}
+}
+
+func TestIsRelevant_CreateBypassesIncludeFilter(t *testing.T) {
+	o := newTestObserver(t, Watch{Include: []string{"*.yaml"}})
+
+	// A ConfigMap update surfaces as a Create/Rename on the "..data" symlink
+	// entry, which never matches a realistic Include glob like "*.yaml".
+	event := fsnotify.Event{Name: "/srv/dashboards/..data", Op: fsnotify.Create}
+
+	if !o.isRelevant(event) {
+		t.Errorf("Create events must bypass the include filter to catch ConfigMap symlink swaps")
+	}
+}
+
+func TestIsRelevant_IgnoredPathIsNeverRelevant(t *testing.T) {
+	o := newTestObserver(t, Watch{Ignore: []string{".git"}})
+
+	event := fsnotify.Event{Name: "/srv/dashboards/.git/HEAD", Op: fsnotify.Create}
+
+	if o.isRelevant(event) {
+		t.Errorf("ignored paths should never be relevant, even for Create events")
+	}
+}
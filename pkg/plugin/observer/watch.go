@@ -0,0 +1,123 @@
+package observer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// Watch describes what an Observer watches: the root paths to start from,
+// which files under them should trigger a reload (Include), and which
+// files/directories should never be watched or trigger one (Ignore).
+type Watch struct {
+	Paths   []string
+	Include []string
+	Ignore  []string
+}
+
+// DefaultIgnore is used for targets that don't configure their own ignore
+// list. It covers VCS metadata and common editor temp/swap files.
+var DefaultIgnore = []string{".git", ".hg", ".svn", "*.tmp", "*.swp", "*~", ".DS_Store"}
+
+// newWatcher creates an fsnotify.Watcher and adds watch.Paths to it. A root
+// that is a directory is walked recursively, adding every non-ignored
+// subdirectory (fsnotify only watches directories, not whole trees). A root
+// that is a single file is added directly, to support the common
+// ConfigMap-symlink layout of watching one mounted file. Paths that don't
+// exist yet are logged and skipped rather than failing the watcher.
+func newWatcher(logger log.Logger, watch Watch) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+
+	for _, path := range watch.Paths {
+		if err := addRecursive(watcher, logger, path, watch.Ignore); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				logger.Warn("failed to add path to watcher", "path", path, "err", err)
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to add path %q to watcher: %w", path, err)
+		}
+	}
+
+	return watcher, nil
+}
+
+// addRecursive adds root to watcher. If root is a directory, every
+// non-ignored subdirectory is added too.
+func addRecursive(watcher *fsnotify.Watcher, logger log.Logger, root string, ignore []string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return watcher.Add(root)
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if path != root && isIgnored(path, ignore) {
+			return filepath.SkipDir
+		}
+
+		if err := watcher.Add(path); err != nil {
+			logger.Warn("failed to watch directory", "path", path, "error", err)
+		}
+
+		return nil
+	})
+}
+
+// isIgnored reports whether any component of path matches an ignore
+// pattern, e.g. ".git" anywhere in the path, or "*.tmp"/"*~" as a file name.
+func isIgnored(path string, ignore []string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		for _, pattern := range ignore {
+			pattern = strings.TrimSuffix(pattern, "/")
+
+			if ok, err := filepath.Match(pattern, part); err == nil && ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isIncluded reports whether path matches one of the include glob patterns.
+// No include patterns means everything is included. A "**/" prefix is
+// treated as "at any depth", matched against the file's base name, since
+// every matching directory is already watched individually.
+func isIncluded(path string, include []string) bool {
+	if len(include) == 0 {
+		return true
+	}
+
+	base := filepath.Base(path)
+
+	for _, pattern := range include {
+		pattern = strings.TrimPrefix(pattern, "**/")
+
+		if ok, err := filepath.Match(pattern, base); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,46 @@
+package observer
+
+import "testing"
+
+func TestIsIgnored(t *testing.T) {
+	ignore := []string{".git", "*.tmp", "*~"}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/srv/dashboards/foo.yaml", false},
+		{"/srv/dashboards/.git/HEAD", true},
+		{"/srv/dashboards/scratch.tmp", true},
+		{"/srv/dashboards/foo.yaml~", true},
+		{"/srv/.git", true},
+	}
+
+	for _, tt := range tests {
+		if got := isIgnored(tt.path, ignore); got != tt.want {
+			t.Errorf("isIgnored(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsIncluded(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		include []string
+		want    bool
+	}{
+		{"no include patterns matches everything", "/srv/README.md", nil, true},
+		{"matching extension", "/srv/dashboards/foo.yaml", []string{"*.yaml"}, true},
+		{"non-matching extension", "/srv/dashboards/README.md", []string{"*.yaml"}, false},
+		{"any-depth prefix matches basename", "/srv/dashboards/team/foo.json", []string{"**/*.json"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isIncluded(tt.path, tt.include); got != tt.want {
+				t.Errorf("isIncluded(%q, %v) = %v, want %v", tt.path, tt.include, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"context"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// supervisorInitialInterval and supervisorMaxInterval bound how quickly a
+// crashed watcher goroutine is restarted: fast enough to recover promptly,
+// slow enough not to hammer the filesystem/Grafana if it keeps crashing.
+const (
+	supervisorInitialInterval = time.Second
+	supervisorMaxInterval     = 30 * time.Second
+)
+
+// supervise runs fn(ctx) until ctx is cancelled, recovering from panics and
+// restarting fn with exponential backoff whenever it exits unexpectedly
+// (panic, or returning before ctx is done). reset is called before every
+// restart but the first run, so fn can rebuild any state a prior run left
+// unusable. Every restart increments restarts so CheckHealth can surface it.
+func supervise(ctx context.Context, logger log.Logger, restarts *atomic.Int64, fn func(ctx context.Context), reset func() error) {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = supervisorInitialInterval
+	b.MaxInterval = supervisorMaxInterval
+	b.MaxElapsedTime = 0 // retried forever, bounded only by ctx cancellation
+
+	for first := true; ; first = false {
+		if !first {
+			if err := reset(); err != nil {
+				logger.Error("failed to reset watcher before restart", "error", err)
+			}
+		}
+
+		runSupervised(ctx, logger, fn)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		restarts.Add(1)
+
+		wait := b.NextBackOff()
+
+		logger.Warn("watcher goroutine exited unexpectedly, restarting", "wait", wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runSupervised runs fn once, recovering from and logging any panic so the
+// caller's restart loop keeps running instead of crashing the plugin.
+func runSupervised(ctx context.Context, logger log.Logger, fn func(ctx context.Context)) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("recovered from panic in watcher goroutine", "panic", r, "stack", string(debug.Stack()))
+		}
+	}()
+
+	fn(ctx)
+}
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func TestRunSupervisedRecoversPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+
+	func() {
+		defer close(done)
+
+		runSupervised(ctx, log.NewNullLogger(), func(context.Context) {
+			panic("boom")
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runSupervised did not return after a panic")
+	}
+}
+
+func TestSuperviseRestartsAfterPanicAndCallsReset(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		restarts  atomic.Int64
+		resets    atomic.Int64
+		callCount atomic.Int64
+	)
+
+	secondCallStarted := make(chan struct{})
+
+	fn := func(ctx context.Context) {
+		if callCount.Add(1) == 1 {
+			panic("boom")
+		}
+
+		close(secondCallStarted)
+		<-ctx.Done()
+	}
+
+	reset := func() error {
+		resets.Add(1)
+
+		return nil
+	}
+
+	superviseDone := make(chan struct{})
+
+	go func() {
+		defer close(superviseDone)
+
+		supervise(ctx, log.NewNullLogger(), &restarts, fn, reset)
+	}()
+
+	select {
+	case <-secondCallStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervise never restarted fn after the panic")
+	}
+
+	if got := restarts.Load(); got != 1 {
+		t.Errorf("restarts = %d, want 1", got)
+	}
+
+	if got := resets.Load(); got != 1 {
+		t.Errorf("reset calls = %d, want 1", got)
+	}
+
+	cancel()
+
+	select {
+	case <-superviseDone:
+	case <-time.After(time.Second):
+		t.Fatal("supervise did not return after ctx was cancelled")
+	}
+}
@@ -1,13 +1,23 @@
+// Package transport provides http.RoundTripper implementations for the
+// different ways operators authenticate the plugin against Grafana's admin
+// API: a static service-account bearer token, a token file that's re-read on
+// every request (for rotated/projected Kubernetes tokens), and HTTP basic
+// auth. Mutual TLS is configured separately, into the transport's TLS config
+// rather than as a wrapping RoundTripper; see applyMTLSOptions in
+// pkg/plugin.
 package transport
 
 import (
+	"fmt"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 )
 
 // TokenTransport is an http.RoundTripper that adds an Authorization header
-// with the Bearer token to the request.
+// with a fixed bearer token to the request.
 type TokenTransport struct {
 	token string
 	next  http.RoundTripper
@@ -29,3 +39,60 @@ func (t *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	return t.next.RoundTrip(req)
 }
+
+// FileTokenTransport is an http.RoundTripper that re-reads its bearer token
+// from a file on every request, so a rotated Kubernetes projected service
+// account token is picked up without restarting the plugin.
+type FileTokenTransport struct {
+	path string
+	next http.RoundTripper
+}
+
+func NewFileTokenTransport(path string, next http.RoundTripper) *FileTokenTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &FileTokenTransport{
+		path: path,
+		next: next,
+	}
+}
+
+func (t *FileTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := os.ReadFile(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file %q: %w", t.path, err)
+	}
+
+	req.Header.Set(backend.OAuthIdentityTokenHeaderName, "Bearer "+strings.TrimSpace(string(token)))
+
+	return t.next.RoundTrip(req)
+}
+
+// BasicAuthTransport is an http.RoundTripper that adds HTTP basic auth
+// credentials to the request, for Grafana instances still authenticated
+// with an admin username/password rather than a service account token.
+type BasicAuthTransport struct {
+	username string
+	password string
+	next     http.RoundTripper
+}
+
+func NewBasicAuthTransport(username, password string, next http.RoundTripper) *BasicAuthTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &BasicAuthTransport{
+		username: username,
+		password: password,
+		next:     next,
+	}
+}
+
+func (t *BasicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.SetBasicAuth(t.username, t.password)
+
+	return t.next.RoundTrip(req)
+}
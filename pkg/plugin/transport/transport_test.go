@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func capturingTransport(captured *http.Request) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		*captured = *req
+
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+}
+
+func TestBearerTokenTransport(t *testing.T) {
+	var captured http.Request
+
+	rt := NewBearerTokenTransport("s3cr3t", capturingTransport(&captured))
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", http.NoBody)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+
+	if got, want := captured.Header.Get("Authorization"), "Bearer s3cr3t"; got != want {
+		t.Errorf("Authorization header = %q, want %q", got, want)
+	}
+}
+
+func TestFileTokenTransportReReadsOnEveryRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatalf("write token file: %v", err)
+	}
+
+	var captured http.Request
+
+	rt := NewFileTokenTransport(path, capturingTransport(&captured))
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", http.NoBody)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+
+	if got, want := captured.Header.Get("Authorization"), "Bearer first"; got != want {
+		t.Errorf("Authorization header = %q, want %q", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("rotated\n"), 0o600); err != nil {
+		t.Fatalf("rewrite token file: %v", err)
+	}
+
+	req2, err := http.NewRequest(http.MethodPost, "http://example.com", http.NoBody)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	if _, err := rt.RoundTrip(req2); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+
+	if got, want := captured.Header.Get("Authorization"), "Bearer rotated"; got != want {
+		t.Errorf("rotated token not picked up: Authorization header = %q, want %q", got, want)
+	}
+}
+
+func TestFileTokenTransportMissingFile(t *testing.T) {
+	rt := NewFileTokenTransport(filepath.Join(t.TempDir(), "missing"), http.DefaultTransport)
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", http.NoBody)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	if _, err := rt.RoundTrip(req); err == nil {
+		t.Errorf("expected an error when the token file does not exist")
+	}
+}
+
+func TestBasicAuthTransport(t *testing.T) {
+	var captured http.Request
+
+	rt := NewBasicAuthTransport("admin", "hunter2", capturingTransport(&captured))
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", http.NoBody)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+
+	user, pass, ok := captured.BasicAuth()
+	if !ok {
+		t.Fatalf("expected basic auth credentials to be set")
+	}
+
+	if user != "admin" || pass != "hunter2" {
+		t.Errorf("BasicAuth() = (%q, %q), want (\"admin\", \"hunter2\")", user, pass)
+	}
+}